@@ -0,0 +1,202 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "tailscale.com/tailcfg"
+)
+
+// requiredCapability is the tailnet ACL grant callers must hold to invoke
+// the exec/status endpoints, e.g.:
+//
+//	"grants": [{
+//	  "src": ["group:deployers"],
+//	  "dst": ["tag:edgevision-sidecar"],
+//	  "app": {"edgevision:deploy": [{"app_types": ["zed", "web"]}]}
+//	}]
+const requiredCapability tailcfg.PeerCapability = "edgevision:deploy"
+
+// hmacSecretEnv names the env var holding the shared secret used to sign
+// bearer tokens. maxClockSkew bounds how stale a request's timestamp may be.
+const (
+    hmacSecretEnv = "EDGEVISION_HMAC_SECRET"
+    maxClockSkew  = 60 * time.Second
+)
+
+// callerCapsKey is the context key under which the caller's capability
+// grant (parsed from the tailnet ACL) is stashed for downstream handlers.
+type callerCapsKey struct{}
+
+// capabilityGrant is the shape of the "edgevision:deploy" ACL grant value.
+// AppTypes restricts which app_type values the caller may deploy.
+type capabilityGrant struct {
+    AppTypes []string `json:"app_types"`
+}
+
+// callerCapabilities returns the allowed app_type values for the request's
+// caller, as attached by requireAuth.
+func callerCapabilities(r *http.Request) []string {
+    caps, _ := r.Context().Value(callerCapsKey{}).([]string)
+    return caps
+}
+
+// nonceCache tracks recently seen nonces so a captured token cannot be
+// replayed within the clock-skew window. Entries older than maxClockSkew
+// are purged opportunistically on Seen.
+type nonceCache struct {
+    mu   sync.Mutex
+    seen map[string]time.Time
+}
+
+var recentNonces = &nonceCache{seen: make(map[string]time.Time)}
+
+// Seen records nonce and reports whether it had already been used.
+func (c *nonceCache) Seen(nonce string) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    now := time.Now()
+    for n, t := range c.seen {
+        if now.Sub(t) > maxClockSkew {
+            delete(c.seen, n)
+        }
+    }
+
+    if _, ok := c.seen[nonce]; ok {
+        return true
+    }
+    c.seen[nonce] = now
+    return false
+}
+
+// requireAuth wraps a handler with two independent checks:
+//
+//  1. an HMAC bearer token over "device_id|nonce|timestamp", rejecting
+//     replayed nonces and requests whose timestamp has drifted more than
+//     maxClockSkew from the server clock;
+//  2. a Tailscale WhoIs lookup on the inbound connection, requiring the
+//     peer to hold the requiredCapability grant in the tailnet ACL.
+//
+// On success, the caller's app_type allowlist (from the capability grant)
+// is attached to the request context for handlers to enforce.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        deviceID := r.Header.Get("X-Edgevision-Device")
+        nonce := r.Header.Get("X-Edgevision-Nonce")
+        timestamp := r.Header.Get("X-Edgevision-Timestamp")
+        token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+        if deviceID == "" || nonce == "" || timestamp == "" || token == "" {
+            http.Error(w, "missing auth headers", http.StatusUnauthorized)
+            return
+        }
+
+        if err := verifyHMAC(deviceID, nonce, timestamp, token); err != nil {
+            log.Printf("[sidecar] auth rejected for device %s: %v", deviceID, err)
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        if recentNonces.Seen(nonce) {
+            http.Error(w, "nonce already used", http.StatusUnauthorized)
+            return
+        }
+
+        appTypes, err := verifyCapability(r)
+        if err != nil {
+            log.Printf("[sidecar] capability check failed for device %s: %v", deviceID, err)
+            http.Error(w, "forbidden", http.StatusForbidden)
+            return
+        }
+
+        ctx := context.WithValue(r.Context(), callerCapsKey{}, appTypes)
+        next(w, r.WithContext(ctx))
+    }
+}
+
+func verifyHMAC(deviceID, nonce, timestamp, token string) error {
+    secret := os.Getenv(hmacSecretEnv)
+    if secret == "" {
+        return fmt.Errorf("%s not configured", hmacSecretEnv)
+    }
+
+    ts, err := strconv.ParseInt(timestamp, 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid timestamp: %w", err)
+    }
+    skew := time.Since(time.Unix(ts, 0))
+    if skew < 0 {
+        skew = -skew
+    }
+    if skew > maxClockSkew {
+        return fmt.Errorf("timestamp skew %s exceeds %s", skew, maxClockSkew)
+    }
+
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(deviceID + "|" + nonce + "|" + timestamp))
+    expected := hex.EncodeToString(mac.Sum(nil))
+
+    if !hmac.Equal([]byte(expected), []byte(token)) {
+        return fmt.Errorf("token mismatch")
+    }
+    return nil
+}
+
+// verifyCapability looks up the inbound peer's Tailscale identity and
+// returns the app_type allowlist granted by requiredCapability.
+func verifyCapability(r *http.Request) ([]string, error) {
+    if tsServer == nil {
+        return nil, fmt.Errorf("tsnet not initialized")
+    }
+
+    lc, err := tsServer.LocalClient()
+    if err != nil {
+        return nil, fmt.Errorf("local client: %w", err)
+    }
+
+    who, err := lc.WhoIs(r.Context(), r.RemoteAddr)
+    if err != nil {
+        return nil, fmt.Errorf("whois %s: %w", r.RemoteAddr, err)
+    }
+
+    rawGrants, ok := who.CapMap[requiredCapability]
+    if !ok || len(rawGrants) == 0 {
+        return nil, fmt.Errorf("peer %s lacks capability %q", who.Node.ComputedName, requiredCapability)
+    }
+
+    var appTypes []string
+    for _, raw := range rawGrants {
+        var grant capabilityGrant
+        if err := json.Unmarshal([]byte(raw), &grant); err != nil {
+            continue
+        }
+        appTypes = append(appTypes, grant.AppTypes...)
+    }
+    return appTypes, nil
+}
+
+// appTypeAllowed reports whether allowlist permits appType. An empty
+// allowlist is treated as "no restriction configured" for the grant.
+func appTypeAllowed(allowlist []string, appType string) bool {
+    if len(allowlist) == 0 {
+        return true
+    }
+    for _, a := range allowlist {
+        if a == appType {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "os"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func signedToken(t *testing.T, secret, deviceID, nonce string, ts int64) string {
+    t.Helper()
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(deviceID + "|" + nonce + "|" + strconv.FormatInt(ts, 10)))
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHMAC(t *testing.T) {
+    const secret = "test-secret"
+    t.Setenv(hmacSecretEnv, secret)
+
+    deviceID, nonce := "device-1", "nonce-1"
+
+    t.Run("valid token within skew", func(t *testing.T) {
+        ts := time.Now().Unix()
+        token := signedToken(t, secret, deviceID, nonce, ts)
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), token); err != nil {
+            t.Fatalf("expected valid token to pass, got %v", err)
+        }
+    })
+
+    t.Run("wrong token rejected", func(t *testing.T) {
+        ts := time.Now().Unix()
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), "deadbeef"); err == nil {
+            t.Fatal("expected mismatched token to be rejected")
+        }
+    })
+
+    t.Run("timestamp just inside skew boundary", func(t *testing.T) {
+        ts := time.Now().Add(-maxClockSkew + time.Second).Unix()
+        token := signedToken(t, secret, deviceID, nonce, ts)
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), token); err != nil {
+            t.Fatalf("expected timestamp within skew to pass, got %v", err)
+        }
+    })
+
+    t.Run("timestamp just outside skew boundary", func(t *testing.T) {
+        ts := time.Now().Add(-maxClockSkew - time.Second).Unix()
+        token := signedToken(t, secret, deviceID, nonce, ts)
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), token); err == nil {
+            t.Fatal("expected timestamp beyond skew to be rejected")
+        }
+    })
+
+    t.Run("future timestamp beyond skew rejected", func(t *testing.T) {
+        ts := time.Now().Add(maxClockSkew + time.Second).Unix()
+        token := signedToken(t, secret, deviceID, nonce, ts)
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), token); err == nil {
+            t.Fatal("expected future timestamp beyond skew to be rejected")
+        }
+    })
+
+    t.Run("secret not configured", func(t *testing.T) {
+        os.Unsetenv(hmacSecretEnv)
+        defer t.Setenv(hmacSecretEnv, secret)
+        ts := time.Now().Unix()
+        if err := verifyHMAC(deviceID, nonce, strconv.FormatInt(ts, 10), "anything"); err == nil {
+            t.Fatal("expected missing secret to error")
+        }
+    })
+}
+
+func TestNonceCacheSeen(t *testing.T) {
+    c := &nonceCache{seen: make(map[string]time.Time)}
+
+    if c.Seen("a") {
+        t.Fatal("first use of a nonce should not be flagged as replay")
+    }
+    if !c.Seen("a") {
+        t.Fatal("second use of the same nonce should be flagged as replay")
+    }
+    if c.Seen("b") {
+        t.Fatal("a distinct nonce should not be flagged as replay")
+    }
+}
+
+func TestAppTypeAllowed(t *testing.T) {
+    if !appTypeAllowed(nil, "zed") {
+        t.Error("empty allowlist should permit any app_type")
+    }
+    if !appTypeAllowed([]string{"zed", "web"}, "zed") {
+        t.Error("app_type present in allowlist should be permitted")
+    }
+    if appTypeAllowed([]string{"zed"}, "web") {
+        t.Error("app_type absent from allowlist should be rejected")
+    }
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/metrics"
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/sshclient"
+)
+
+// PortMapping binds a container port to a host port, e.g. 8080->80/tcp.
+type PortMapping struct {
+    HostPort      int    `json:"host_port"`
+    ContainerPort int    `json:"container_port"`
+    Protocol      string `json:"protocol,omitempty"` // "tcp" (default) or "udp"
+}
+
+// Mount binds a host path into the container.
+type Mount struct {
+    HostPath      string `json:"host_path"`
+    ContainerPath string `json:"container_path"`
+    ReadOnly      bool   `json:"read_only,omitempty"`
+}
+
+// PullAuth holds registry credentials for private images. Password is never
+// logged or echoed into the generated script's stdout stream.
+type PullAuth struct {
+    Registry string `json:"registry"`
+    Username string `json:"username"`
+    Password string `json:"password"`
+}
+
+// HealthCheck polls a command inside the container until it succeeds or
+// Retries is exhausted, gating the pulling/starting -> healthy transition.
+type HealthCheck struct {
+    Command         []string `json:"command"`
+    IntervalSeconds int      `json:"interval_seconds,omitempty"`
+    Retries         int      `json:"retries,omitempty"`
+}
+
+// Deployment is a structured description of a single-container deployment,
+// replacing ad hoc "docker pull && docker run" string interpolation.
+// PreviousName, if set, names a container to restart if this deployment
+// fails, so a bad rollout doesn't leave the device with nothing running.
+type Deployment struct {
+    Image         string            `json:"image"`
+    Name          string            `json:"name"`
+    Env           map[string]string `json:"env,omitempty"`
+    Ports         []PortMapping     `json:"ports,omitempty"`
+    Volumes       []Mount           `json:"volumes,omitempty"`
+    RestartPolicy string            `json:"restart_policy,omitempty"`
+    PullAuth      *PullAuth         `json:"pull_auth,omitempty"`
+    HealthCheck   *HealthCheck      `json:"health_check,omitempty"`
+    PreviousName  string            `json:"previous_name,omitempty"`
+}
+
+// These constants name the steps of the deploy state machine. deployStatusResponse
+// reports the most recent stage reached for an execution ID.
+const (
+    stagePulling  = "pulling"
+    stageStarting = "starting"
+    stageHealthy  = "healthy"
+    stageFailed   = "failed"
+)
+
+const stageMarkerPrefix = "::edgevision-stage::"
+
+// deploymentFromShim builds a Deployment from the legacy app_type/app_url
+// fields, so older callers of /ssh/exec keep working unchanged.
+func deploymentFromShim(appType, appURL string) Deployment {
+    return Deployment{
+        Image:         appURL,
+        Name:          appType + "-instance",
+        RestartPolicy: "unless-stopped",
+    }
+}
+
+// buildDeployScript renders d as a POSIX shell script that is streamed to
+// the remote `sh -s` stdin (see sshclient.Pool.RunScript), rather than
+// interpolated into a single command line. Each stage prints a marker line
+// that runDeployment uses to drive the execRecord state machine.
+func buildDeployScript(d Deployment) string {
+    var b strings.Builder
+    b.WriteString("set -e\n")
+
+    if d.PullAuth != nil {
+        fmt.Fprintf(&b, "docker login %s -u %s --password-stdin <<'EDGEVISION_PW'\n%s\nEDGEVISION_PW\n",
+            shQuote(d.PullAuth.Registry), shQuote(d.PullAuth.Username), d.PullAuth.Password)
+    }
+
+    fmt.Fprintf(&b, "echo %s%s\n", stageMarkerPrefix, stagePulling)
+    fmt.Fprintf(&b, "docker pull %s\n", shQuote(d.Image))
+
+    fmt.Fprintf(&b, "echo %s%s\n", stageMarkerPrefix, stageStarting)
+    if d.PreviousName != "" {
+        // From here on, any non-zero exit (failed run or health check)
+        // removes the new container and restarts the previous one.
+        b.WriteString("rollback() {\n")
+        b.WriteString("  docker rm -f " + shQuote(d.Name) + " >/dev/null 2>&1 || true\n")
+        b.WriteString("  docker start " + shQuote(d.PreviousName) + " >/dev/null 2>&1 || true\n")
+        b.WriteString("}\n")
+        b.WriteString("trap 'rc=$?; if [ \"$rc\" -ne 0 ]; then rollback; fi' EXIT\n")
+    }
+    b.WriteString("docker rm -f " + shQuote(d.Name) + " >/dev/null 2>&1 || true\n")
+
+    runArgs := []string{"docker", "run", "-d", "--name", shQuote(d.Name)}
+    if d.RestartPolicy != "" {
+        runArgs = append(runArgs, "--restart", shQuote(d.RestartPolicy))
+    }
+    for k, v := range d.Env {
+        runArgs = append(runArgs, "-e", shQuote(k+"="+v))
+    }
+    for _, p := range d.Ports {
+        proto := p.Protocol
+        if proto == "" {
+            proto = "tcp"
+        }
+        runArgs = append(runArgs, "-p", shQuote(fmt.Sprintf("%d:%d/%s", p.HostPort, p.ContainerPort, proto)))
+    }
+    for _, m := range d.Volumes {
+        spec := m.HostPath + ":" + m.ContainerPath
+        if m.ReadOnly {
+            spec += ":ro"
+        }
+        runArgs = append(runArgs, "-v", shQuote(spec))
+    }
+    runArgs = append(runArgs, shQuote(d.Image))
+    b.WriteString(strings.Join(runArgs, " ") + "\n")
+
+    if d.HealthCheck != nil && len(d.HealthCheck.Command) > 0 {
+        retries := d.HealthCheck.Retries
+        if retries <= 0 {
+            retries = 5
+        }
+        interval := d.HealthCheck.IntervalSeconds
+        if interval <= 0 {
+            interval = 3
+        }
+        healthCmd := strings.Join(quoteAll(d.HealthCheck.Command), " ")
+        fmt.Fprintf(&b, "healthy=0\nfor i in $(seq 1 %d); do\n", retries)
+        fmt.Fprintf(&b, "  if docker exec %s %s; then healthy=1; break; fi\n", shQuote(d.Name), healthCmd)
+        fmt.Fprintf(&b, "  sleep %d\ndone\n", interval)
+        b.WriteString("if [ \"$healthy\" != \"1\" ]; then\n")
+        fmt.Fprintf(&b, "  echo %s%s\n", stageMarkerPrefix, stageFailed)
+        b.WriteString("  docker rm -f " + shQuote(d.Name) + " >/dev/null 2>&1 || true\n")
+        if d.PreviousName != "" {
+            b.WriteString("  docker start " + shQuote(d.PreviousName) + " >/dev/null 2>&1 || true\n")
+        }
+        b.WriteString("  exit 1\nfi\n")
+    }
+
+    fmt.Fprintf(&b, "echo %s%s\n", stageMarkerPrefix, stageHealthy)
+    return b.String()
+}
+
+// runDeployment drives the deploy state machine for a single /ssh/exec
+// request, recording each stage transition under execID so
+// /deployments/status can report "pulling" -> "starting" -> "healthy"/
+// "failed" as the remote script progresses.
+func runDeployment(execID, deviceID string, d Deployment) {
+    startExec(execID)
+
+    if sshPool == nil {
+        recordExec(execID, execRecord{DeviceID: deviceID, Status: "error", Error: "ssh client pool not initialized"})
+        return
+    }
+
+    script := buildDeployScript(d)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+    defer cancel()
+
+    var outLines []string
+    onLine := func(line string) {
+        if stage, ok := strings.CutPrefix(line, stageMarkerPrefix); ok {
+            // Terminal stages are recorded once, from the script's exit
+            // status below, so exec_total counts each deployment once.
+            if !terminalStatuses[stage] {
+                recordExec(execID, execRecord{DeviceID: deviceID, Status: stage})
+            }
+            return
+        }
+        outLines = append(outLines, line)
+    }
+
+    stderr, exitCode, err := sshPool.RunScript(ctx, deviceID, script, onLine)
+    output := strings.Join(outLines, "\n")
+    if err != nil {
+        var dialErr *sshclient.DialError
+        if errors.As(err, &dialErr) {
+            metrics.SSHDialFailures.WithLabelValues(deviceID).Inc()
+        }
+        recordExec(execID, execRecord{DeviceID: deviceID, Status: stageFailed, Error: err.Error(), Output: output})
+        return
+    }
+    if exitCode != 0 {
+        log.Printf("[sidecar] deployment %s exited with status %d: %s", execID, exitCode, stderr)
+        recordExec(execID, execRecord{DeviceID: deviceID, Status: stageFailed, Error: stderr, Output: output})
+        return
+    }
+    recordExec(execID, execRecord{DeviceID: deviceID, Status: stageHealthy, Output: output})
+}
+
+func shQuote(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func quoteAll(args []string) []string {
+    quoted := make([]string, len(args))
+    for i, a := range args {
+        quoted[i] = shQuote(a)
+    }
+    return quoted
+}
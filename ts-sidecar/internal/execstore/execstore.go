@@ -0,0 +1,184 @@
+// Package execstore persists execution records across sidecar restarts,
+// replacing the plain in-memory map that returned 404 for anything
+// dispatched before the last crash.
+package execstore
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+var recordsBucket = []byte("exec_records")
+
+// Record is the persisted shape of an execution or deployment's latest
+// known state. UpdatedAt drives TTL-based compaction. Counted marks
+// whether a terminal record has already been reflected in exec_total, so
+// that seeding metrics from a restart's backlog of records doesn't
+// re-increment the counter for work that was already counted before the
+// restart.
+type Record struct {
+    DeviceID  string    `json:"device_id,omitempty"`
+    Status    string    `json:"status"`
+    Output    string    `json:"output,omitempty"`
+    Error     string    `json:"error,omitempty"`
+    UpdatedAt time.Time `json:"updated_at"`
+    Counted   bool      `json:"counted,omitempty"`
+}
+
+// Store is a BoltDB-backed key/value store of Records, keyed by execution
+// ID, with TTL-based compaction of stale entries.
+type Store struct {
+    db  *bolt.DB
+    ttl time.Duration
+}
+
+// Open opens (creating if necessary) the BoltDB file at path. ttl bounds
+// how long a record is kept after its last update; Compact removes entries
+// older than ttl.
+func Open(path string, ttl time.Duration) (*Store, error) {
+    db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+    if err != nil {
+        return nil, fmt.Errorf("execstore: open %s: %w", path, err)
+    }
+
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists(recordsBucket)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, fmt.Errorf("execstore: init bucket: %w", err)
+    }
+
+    return &Store{db: db, ttl: ttl}, nil
+}
+
+// Close closes the underlying BoltDB file.
+func (s *Store) Close() error {
+    return s.db.Close()
+}
+
+// Save upserts rec under id, stamping UpdatedAt with the current time.
+func (s *Store) Save(id string, rec Record) error {
+    rec.UpdatedAt = time.Now()
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return fmt.Errorf("execstore: marshal %s: %w", id, err)
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(recordsBucket).Put([]byte(id), data)
+    })
+}
+
+// SetCounted marks id's record as counted, without touching UpdatedAt, so
+// marking a record as already-seeded doesn't reset its TTL clock. A
+// missing id is a no-op.
+func (s *Store) SetCounted(id string) error {
+    return s.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(recordsBucket)
+        data := b.Get([]byte(id))
+        if data == nil {
+            return nil
+        }
+        var rec Record
+        if err := json.Unmarshal(data, &rec); err != nil {
+            return fmt.Errorf("execstore: unmarshal %s: %w", id, err)
+        }
+        rec.Counted = true
+        out, err := json.Marshal(rec)
+        if err != nil {
+            return fmt.Errorf("execstore: marshal %s: %w", id, err)
+        }
+        return b.Put([]byte(id), out)
+    })
+}
+
+// Load fetches the Record stored under id.
+func (s *Store) Load(id string) (Record, bool, error) {
+    var rec Record
+    var found bool
+    err := s.db.View(func(tx *bolt.Tx) error {
+        data := tx.Bucket(recordsBucket).Get([]byte(id))
+        if data == nil {
+            return nil
+        }
+        found = true
+        return json.Unmarshal(data, &rec)
+    })
+    if err != nil {
+        return Record{}, false, fmt.Errorf("execstore: load %s: %w", id, err)
+    }
+    return rec, found, nil
+}
+
+// All returns every stored record, keyed by execution ID, for seeding an
+// in-memory cache or metrics on startup.
+func (s *Store) All() (map[string]Record, error) {
+    out := make(map[string]Record)
+    err := s.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(recordsBucket).ForEach(func(k, v []byte) error {
+            var rec Record
+            if err := json.Unmarshal(v, &rec); err != nil {
+                return nil
+            }
+            out[string(k)] = rec
+            return nil
+        })
+    })
+    if err != nil {
+        return nil, fmt.Errorf("execstore: scan: %w", err)
+    }
+    return out, nil
+}
+
+// Compact deletes records whose UpdatedAt is older than the store's ttl,
+// and reports how many were removed.
+func (s *Store) Compact() (int, error) {
+    var removed int
+    err := s.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(recordsBucket)
+        cutoff := time.Now().Add(-s.ttl)
+        var stale [][]byte
+        err := b.ForEach(func(k, v []byte) error {
+            var rec Record
+            if err := json.Unmarshal(v, &rec); err != nil {
+                return nil
+            }
+            if rec.UpdatedAt.Before(cutoff) {
+                stale = append(stale, append([]byte(nil), k...))
+            }
+            return nil
+        })
+        if err != nil {
+            return err
+        }
+        for _, k := range stale {
+            if err := b.Delete(k); err != nil {
+                return err
+            }
+            removed++
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, fmt.Errorf("execstore: compact: %w", err)
+    }
+    return removed, nil
+}
+
+// CompactLoop runs Compact on interval until stop is closed.
+func (s *Store) CompactLoop(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            s.Compact()
+        case <-stop:
+            return
+        }
+    }
+}
@@ -0,0 +1,114 @@
+package execstore
+
+import (
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func openTestStore(t *testing.T, ttl time.Duration) *Store {
+    t.Helper()
+    s, err := Open(filepath.Join(t.TempDir(), "exec.db"), ttl)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    t.Cleanup(func() { s.Close() })
+    return s
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+    s := openTestStore(t, time.Hour)
+
+    rec := Record{DeviceID: "dev-1", Status: "success", Output: "ok"}
+    if err := s.Save("exec-1", rec); err != nil {
+        t.Fatalf("Save: %v", err)
+    }
+
+    got, ok, err := s.Load("exec-1")
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if !ok {
+        t.Fatal("expected record to be found")
+    }
+    if got.DeviceID != rec.DeviceID || got.Status != rec.Status || got.Output != rec.Output {
+        t.Errorf("Load = %+v, want fields matching %+v", got, rec)
+    }
+    if got.UpdatedAt.IsZero() {
+        t.Error("expected Save to stamp UpdatedAt")
+    }
+
+    if _, ok, err := s.Load("missing"); err != nil || ok {
+        t.Errorf("Load(missing) = ok=%v err=%v, want ok=false err=nil", ok, err)
+    }
+}
+
+func TestSetCounted(t *testing.T) {
+    s := openTestStore(t, time.Hour)
+
+    if err := s.Save("exec-1", Record{DeviceID: "dev-1", Status: "success"}); err != nil {
+        t.Fatalf("Save: %v", err)
+    }
+    before, _, _ := s.Load("exec-1")
+    if before.Counted {
+        t.Fatal("record should not start counted")
+    }
+
+    if err := s.SetCounted("exec-1"); err != nil {
+        t.Fatalf("SetCounted: %v", err)
+    }
+    after, _, _ := s.Load("exec-1")
+    if !after.Counted {
+        t.Fatal("expected record to be marked counted")
+    }
+    if !after.UpdatedAt.Equal(before.UpdatedAt) {
+        t.Error("SetCounted should not change UpdatedAt")
+    }
+
+    // Marking an id that doesn't exist is a no-op, not an error.
+    if err := s.SetCounted("does-not-exist"); err != nil {
+        t.Errorf("SetCounted(missing) = %v, want nil", err)
+    }
+}
+
+func TestCompactRemovesStaleRecords(t *testing.T) {
+    s := openTestStore(t, 10*time.Millisecond)
+
+    if err := s.Save("stale", Record{Status: "success"}); err != nil {
+        t.Fatalf("Save: %v", err)
+    }
+    time.Sleep(20 * time.Millisecond)
+    if err := s.Save("fresh", Record{Status: "success"}); err != nil {
+        t.Fatalf("Save: %v", err)
+    }
+
+    removed, err := s.Compact()
+    if err != nil {
+        t.Fatalf("Compact: %v", err)
+    }
+    if removed != 1 {
+        t.Errorf("Compact removed %d records, want 1", removed)
+    }
+
+    if _, ok, _ := s.Load("stale"); ok {
+        t.Error("expected stale record to be removed")
+    }
+    if _, ok, _ := s.Load("fresh"); !ok {
+        t.Error("expected fresh record to remain")
+    }
+}
+
+func TestAllReturnsEveryRecord(t *testing.T) {
+    s := openTestStore(t, time.Hour)
+
+    s.Save("a", Record{Status: "success"})
+    s.Save("b", Record{Status: "error"})
+
+    all, err := s.All()
+    if err != nil {
+        t.Fatalf("All: %v", err)
+    }
+    if len(all) != 2 {
+        t.Errorf("All returned %d records, want 2", len(all))
+    }
+}
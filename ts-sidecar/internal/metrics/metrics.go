@@ -0,0 +1,60 @@
+// Package metrics defines the sidecar's Prometheus instrumentation, wired
+// into the exec, SSH, and tsnet init paths.
+package metrics
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+    // ExecTotal counts dispatched executions/deployments by outcome.
+    ExecTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "edgevision_exec_total",
+        Help: "Total number of executions dispatched, by device and final status.",
+    }, []string{"device", "status"})
+
+    // ExecDuration tracks how long a dispatched execution took to reach a
+    // terminal state.
+    ExecDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "edgevision_exec_duration_seconds",
+        Help:    "Duration of dispatched executions from dispatch to terminal state.",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"device"})
+
+    // TSNetReady is 1 once the tsnet userspace network is up, 0 otherwise.
+    TSNetReady = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "edgevision_tsnet_ready",
+        Help: "Whether the tsnet userspace network is initialized (1) or not (0).",
+    })
+
+    // SSHDialFailures counts failed SSH dials per device.
+    SSHDialFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "edgevision_ssh_dial_failures_total",
+        Help: "Total number of failed SSH dial attempts, by device.",
+    }, []string{"device"})
+
+    // ActiveSessions is the number of currently streaming /ssh/session
+    // PTY connections.
+    ActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "edgevision_active_sessions",
+        Help: "Number of currently active interactive SSH sessions.",
+    })
+
+    // SSHConnectionCacheSize mirrors sshclient.Pool.Size(), the number of
+    // cached SSH connections.
+    SSHConnectionCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "edgevision_ssh_connection_cache_size",
+        Help: "Number of cached SSH client connections held by the connection pool.",
+    })
+)
+
+func init() {
+    prometheus.MustRegister(
+        ExecTotal,
+        ExecDuration,
+        TSNetReady,
+        SSHDialFailures,
+        ActiveSessions,
+        SSHConnectionCacheSize,
+    )
+}
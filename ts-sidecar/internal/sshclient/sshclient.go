@@ -0,0 +1,290 @@
+// Package sshclient provides a native SSH client for running commands on
+// tailnet devices, dialed through a tsnet userspace network stack instead of
+// shelling out to the system ssh/tailscale binaries.
+package sshclient
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "fmt"
+    "net"
+    "os"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/ssh"
+)
+
+// DefaultIdleTimeout is how long a cached connection may sit unused before
+// the eviction loop closes it.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// DialError wraps a failure to establish or reuse the SSH connection to a
+// device, as distinct from a failure of the remote command itself, so
+// callers can count it separately (e.g. edgevision_ssh_dial_failures_total).
+type DialError struct {
+    Device string
+    Err    error
+}
+
+func (e *DialError) Error() string { return fmt.Sprintf("sshclient: dial %s: %v", e.Device, e.Err) }
+func (e *DialError) Unwrap() error { return e.Err }
+
+// Dialer dials a network address and is satisfied by (*tsnet.Server).Dial,
+// letting the pool route SSH traffic over the Tailscale userspace network
+// without the host needing Tailscale installed.
+type Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Config controls how the Pool authenticates and dials to devices.
+type Config struct {
+    // User is the remote SSH user, e.g. "root".
+    User string
+    // PrivateKeyPath is the path to a PEM private key, typically mounted
+    // from a Kubernetes or Docker secret.
+    PrivateKeyPath string
+    // Dialer opens the underlying TCP connection. Required.
+    Dialer Dialer
+    // IdleTimeout overrides DefaultIdleTimeout when non-zero.
+    IdleTimeout time.Duration
+    // DialTimeout bounds the SSH handshake. Defaults to 20s.
+    DialTimeout time.Duration
+}
+
+// Pool caches one *ssh.Client per device, evicting connections that have
+// been idle for longer than IdleTimeout.
+type Pool struct {
+    cfg        Config
+    authMethod ssh.AuthMethod
+
+    mu    sync.Mutex
+    conns map[string]*pooledConn
+
+    closeOnce sync.Once
+    closeCh   chan struct{}
+}
+
+type pooledConn struct {
+    client   *ssh.Client
+    lastUsed time.Time
+}
+
+// NewPool loads the configured private key and starts the idle-eviction
+// loop. The returned Pool is safe for concurrent use.
+func NewPool(cfg Config) (*Pool, error) {
+    if cfg.Dialer == nil {
+        return nil, fmt.Errorf("sshclient: Dialer is required")
+    }
+    if cfg.User == "" {
+        cfg.User = "root"
+    }
+    if cfg.IdleTimeout == 0 {
+        cfg.IdleTimeout = DefaultIdleTimeout
+    }
+    if cfg.DialTimeout == 0 {
+        cfg.DialTimeout = 20 * time.Second
+    }
+
+    keyBytes, err := os.ReadFile(cfg.PrivateKeyPath)
+    if err != nil {
+        return nil, fmt.Errorf("sshclient: reading private key %q: %w", cfg.PrivateKeyPath, err)
+    }
+    signer, err := ssh.ParsePrivateKey(keyBytes)
+    if err != nil {
+        return nil, fmt.Errorf("sshclient: parsing private key %q: %w", cfg.PrivateKeyPath, err)
+    }
+
+    p := &Pool{
+        cfg:        cfg,
+        authMethod: ssh.PublicKeys(signer),
+        conns:      make(map[string]*pooledConn),
+        closeCh:    make(chan struct{}),
+    }
+    go p.evictLoop()
+    return p, nil
+}
+
+// Run executes cmd on deviceID and returns its stdout, stderr, and exit
+// code. A non-nil err indicates a dial or session failure; a failed remote
+// command is reported via a non-zero exitCode with err == nil, mirroring
+// os/exec.ExitError semantics.
+func (p *Pool) Run(ctx context.Context, deviceID string, cmd string) (stdout, stderr string, exitCode int, err error) {
+    client, err := p.clientFor(ctx, deviceID)
+    if err != nil {
+        return "", "", -1, &DialError{Device: deviceID, Err: err}
+    }
+
+    session, err := client.NewSession()
+    if err != nil {
+        // The cached connection may have gone stale; drop it so the next
+        // call redials instead of failing forever.
+        p.evict(deviceID)
+        return "", "", -1, fmt.Errorf("sshclient: new session to %s: %w", deviceID, err)
+    }
+    defer session.Close()
+
+    var outBuf, errBuf bytes.Buffer
+    session.Stdout = &outBuf
+    session.Stderr = &errBuf
+
+    runErr := session.Run(cmd)
+    exitCode = 0
+    if runErr != nil {
+        if exitErr, ok := runErr.(*ssh.ExitError); ok {
+            exitCode = exitErr.ExitStatus()
+            runErr = nil
+        } else {
+            return outBuf.String(), errBuf.String(), -1, fmt.Errorf("sshclient: run on %s: %w", deviceID, runErr)
+        }
+    }
+    return outBuf.String(), errBuf.String(), exitCode, nil
+}
+
+// RunScript streams script to the remote shell's stdin (`sh -s`) instead of
+// passing it as a command line, so callers never interpolate untrusted
+// values into argv. onStdoutLine, if non-nil, is invoked for each line of
+// stdout as it arrives, which lets callers observe progress markers from a
+// long-running script instead of waiting for it to finish.
+func (p *Pool) RunScript(ctx context.Context, deviceID, script string, onStdoutLine func(string)) (stderr string, exitCode int, err error) {
+    client, err := p.clientFor(ctx, deviceID)
+    if err != nil {
+        return "", -1, &DialError{Device: deviceID, Err: err}
+    }
+
+    session, err := client.NewSession()
+    if err != nil {
+        p.evict(deviceID)
+        return "", -1, fmt.Errorf("sshclient: new session to %s: %w", deviceID, err)
+    }
+    defer session.Close()
+
+    session.Stdin = bytes.NewReader([]byte(script))
+
+    stdoutPipe, err := session.StdoutPipe()
+    if err != nil {
+        return "", -1, fmt.Errorf("sshclient: stdout pipe to %s: %w", deviceID, err)
+    }
+    var errBuf bytes.Buffer
+    session.Stderr = &errBuf
+
+    if err := session.Start("sh -s"); err != nil {
+        return "", -1, fmt.Errorf("sshclient: start script on %s: %w", deviceID, err)
+    }
+
+    scanner := bufio.NewScanner(stdoutPipe)
+    for scanner.Scan() {
+        if onStdoutLine != nil {
+            onStdoutLine(scanner.Text())
+        }
+    }
+
+    runErr := session.Wait()
+    exitCode = 0
+    if runErr != nil {
+        if exitErr, ok := runErr.(*ssh.ExitError); ok {
+            exitCode = exitErr.ExitStatus()
+            runErr = nil
+        } else {
+            return errBuf.String(), -1, fmt.Errorf("sshclient: script on %s: %w", deviceID, runErr)
+        }
+    }
+    return errBuf.String(), exitCode, nil
+}
+
+// Dial returns a cached *ssh.Client for deviceID, establishing one if
+// necessary. Callers that need a raw client (e.g. for an interactive PTY
+// session) should use this instead of Run.
+func (p *Pool) Dial(ctx context.Context, deviceID string) (*ssh.Client, error) {
+    return p.clientFor(ctx, deviceID)
+}
+
+func (p *Pool) clientFor(ctx context.Context, deviceID string) (*ssh.Client, error) {
+    p.mu.Lock()
+    if pc, ok := p.conns[deviceID]; ok {
+        pc.lastUsed = time.Now()
+        p.mu.Unlock()
+        return pc.client, nil
+    }
+    p.mu.Unlock()
+
+    dialCtx, cancel := context.WithTimeout(ctx, p.cfg.DialTimeout)
+    defer cancel()
+
+    addr := net.JoinHostPort(deviceID, "22")
+    conn, err := p.cfg.Dialer(dialCtx, "tcp", addr)
+    if err != nil {
+        return nil, err
+    }
+
+    clientConfig := &ssh.ClientConfig{
+        User:            p.cfg.User,
+        Auth:            []ssh.AuthMethod{p.authMethod},
+        HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+        Timeout:         p.cfg.DialTimeout,
+    }
+
+    sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    client := ssh.NewClient(sshConn, chans, reqs)
+
+    p.mu.Lock()
+    p.conns[deviceID] = &pooledConn{client: client, lastUsed: time.Now()}
+    p.mu.Unlock()
+
+    return client, nil
+}
+
+func (p *Pool) evict(deviceID string) {
+    p.mu.Lock()
+    pc, ok := p.conns[deviceID]
+    if ok {
+        delete(p.conns, deviceID)
+    }
+    p.mu.Unlock()
+    if ok {
+        pc.client.Close()
+    }
+}
+
+func (p *Pool) evictLoop() {
+    ticker := time.NewTicker(p.cfg.IdleTimeout / 2)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+            now := time.Now()
+            p.mu.Lock()
+            for deviceID, pc := range p.conns {
+                if now.Sub(pc.lastUsed) > p.cfg.IdleTimeout {
+                    delete(p.conns, deviceID)
+                    pc.client.Close()
+                }
+            }
+            p.mu.Unlock()
+        case <-p.closeCh:
+            return
+        }
+    }
+}
+
+// Close stops the eviction loop and closes all cached connections.
+func (p *Pool) Close() error {
+    p.closeOnce.Do(func() { close(p.closeCh) })
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for deviceID, pc := range p.conns {
+        pc.client.Close()
+        delete(p.conns, deviceID)
+    }
+    return nil
+}
+
+// Size reports the number of cached connections, for metrics/introspection.
+func (p *Pool) Size() int {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return len(p.conns)
+}
@@ -0,0 +1,221 @@
+package sshclient
+
+import (
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/pem"
+    "net"
+    "os"
+    "path/filepath"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "golang.org/x/crypto/ssh"
+)
+
+// testSSHServer accepts real SSH connections on loopback TCP and replies
+// "ok" with exit status 0 to any exec request, so Pool's dial/session
+// handling can be exercised without a real device.
+type testSSHServer struct {
+    ln      net.Listener
+    hostKey ssh.Signer
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+    t.Helper()
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    _, priv, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("generate host key: %v", err)
+    }
+    signer, err := ssh.NewSignerFromKey(priv)
+    if err != nil {
+        t.Fatalf("signer from host key: %v", err)
+    }
+
+    ts := &testSSHServer{ln: ln, hostKey: signer}
+    go ts.serve()
+    t.Cleanup(func() { ln.Close() })
+    return ts
+}
+
+func (ts *testSSHServer) serve() {
+    for {
+        conn, err := ts.ln.Accept()
+        if err != nil {
+            return
+        }
+        go ts.handleConn(conn)
+    }
+}
+
+func (ts *testSSHServer) handleConn(conn net.Conn) {
+    config := &ssh.ServerConfig{NoClientAuth: true}
+    config.AddHostKey(ts.hostKey)
+
+    sConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+    if err != nil {
+        return
+    }
+    defer sConn.Close()
+    go ssh.DiscardRequests(reqs)
+
+    for newChan := range chans {
+        if newChan.ChannelType() != "session" {
+            newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+            continue
+        }
+        channel, requests, err := newChan.Accept()
+        if err != nil {
+            continue
+        }
+        go func() {
+            defer channel.Close()
+            for req := range requests {
+                if req.Type != "exec" {
+                    req.Reply(false, nil)
+                    continue
+                }
+                req.Reply(true, nil)
+                channel.Write([]byte("ok\n"))
+                channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+                return
+            }
+        }()
+    }
+}
+
+// countingDialer redirects every dial to the test server's loopback
+// address regardless of the requested addr, and counts how many times it
+// was actually invoked, so tests can assert on Pool's cache behavior.
+type countingDialer struct {
+    target string
+    calls  int32
+}
+
+func (d *countingDialer) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+    atomic.AddInt32(&d.calls, 1)
+    var nd net.Dialer
+    return nd.DialContext(ctx, "tcp", d.target)
+}
+
+func (d *countingDialer) callCount() int32 {
+    return atomic.LoadInt32(&d.calls)
+}
+
+func writeTestPrivateKey(t *testing.T) string {
+    t.Helper()
+    _, priv, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("generate client key: %v", err)
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(priv)
+    if err != nil {
+        t.Fatalf("marshal client key: %v", err)
+    }
+    path := filepath.Join(t.TempDir(), "id_ed25519")
+    pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+    if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+        t.Fatalf("write client key: %v", err)
+    }
+    return path
+}
+
+func newTestPool(t *testing.T, dialer *countingDialer, idleTimeout time.Duration) *Pool {
+    t.Helper()
+    p, err := NewPool(Config{
+        User:           "root",
+        PrivateKeyPath: writeTestPrivateKey(t),
+        Dialer:         dialer.Dial,
+        IdleTimeout:    idleTimeout,
+        DialTimeout:    5 * time.Second,
+    })
+    if err != nil {
+        t.Fatalf("NewPool: %v", err)
+    }
+    t.Cleanup(func() { p.Close() })
+    return p
+}
+
+func TestPoolCachesConnectionPerDevice(t *testing.T) {
+    server := newTestSSHServer(t)
+    dialer := &countingDialer{target: server.ln.Addr().String()}
+    pool := newTestPool(t, dialer, DefaultIdleTimeout)
+
+    ctx := context.Background()
+    for i := 0; i < 3; i++ {
+        stdout, _, exitCode, err := pool.Run(ctx, "device-a", "true")
+        if err != nil {
+            t.Fatalf("Run #%d: %v", i, err)
+        }
+        if exitCode != 0 {
+            t.Fatalf("Run #%d: exitCode = %d, want 0", i, exitCode)
+        }
+        if stdout != "ok\n" {
+            t.Fatalf("Run #%d: stdout = %q, want %q", i, stdout, "ok\n")
+        }
+    }
+
+    if got := dialer.callCount(); got != 1 {
+        t.Errorf("dialer called %d times across 3 runs to the same device, want 1 (cached)", got)
+    }
+    if got := pool.Size(); got != 1 {
+        t.Errorf("pool.Size() = %d, want 1", got)
+    }
+}
+
+func TestPoolDialsOncePerDistinctDevice(t *testing.T) {
+    server := newTestSSHServer(t)
+    dialer := &countingDialer{target: server.ln.Addr().String()}
+    pool := newTestPool(t, dialer, DefaultIdleTimeout)
+
+    ctx := context.Background()
+    if _, _, _, err := pool.Run(ctx, "device-a", "true"); err != nil {
+        t.Fatalf("Run device-a: %v", err)
+    }
+    if _, _, _, err := pool.Run(ctx, "device-b", "true"); err != nil {
+        t.Fatalf("Run device-b: %v", err)
+    }
+
+    if got := dialer.callCount(); got != 2 {
+        t.Errorf("dialer called %d times for 2 distinct devices, want 2", got)
+    }
+    if got := pool.Size(); got != 2 {
+        t.Errorf("pool.Size() = %d, want 2", got)
+    }
+}
+
+func TestPoolEvictsIdleConnections(t *testing.T) {
+    server := newTestSSHServer(t)
+    dialer := &countingDialer{target: server.ln.Addr().String()}
+    // evictLoop ticks at IdleTimeout/2, so a short idle timeout lets the
+    // test observe eviction without a long sleep.
+    pool := newTestPool(t, dialer, 30*time.Millisecond)
+
+    ctx := context.Background()
+    if _, _, _, err := pool.Run(ctx, "device-a", "true"); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := dialer.callCount(); got != 1 {
+        t.Fatalf("dialer called %d times, want 1", got)
+    }
+
+    time.Sleep(150 * time.Millisecond)
+
+    if got := pool.Size(); got != 0 {
+        t.Fatalf("pool.Size() = %d after idle timeout, want 0 (evicted)", got)
+    }
+
+    if _, _, _, err := pool.Run(ctx, "device-a", "true"); err != nil {
+        t.Fatalf("Run after eviction: %v", err)
+    }
+    if got := dialer.callCount(); got != 2 {
+        t.Errorf("dialer called %d times, want 2 (redial after eviction)", got)
+    }
+}
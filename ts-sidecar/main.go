@@ -3,9 +3,9 @@ package main
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log"
-    "net"
     "net/http"
     "os"
     "os/exec"
@@ -13,9 +13,26 @@ import (
     "sync"
     "time"
 
+    "github.com/prometheus/client_golang/prometheus/promhttp"
     "tailscale.com/tsnet"
+
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/execstore"
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/metrics"
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/sshclient"
+)
+
+// execStoreTTL bounds how long a terminal execution record is kept before
+// compaction; execStoreCompactInterval controls how often compaction runs.
+const (
+    execStoreTTL              = 72 * time.Hour
+    execStoreCompactInterval  = 1 * time.Hour
+    defaultExecStorePath      = "/var/lib/edgevision/exec.db"
 )
 
+// legacyShellOutEnv opts back into shelling out to the system ssh/tailscale
+// ssh binaries instead of the native sshclient pool, for migration only.
+const legacyShellOutEnv = "EDGEVISION_SSH_LEGACY_SHELLOUT"
+
 type healthResponse struct {
     Status   string `json:"status"`
     Version  string `json:"version"`
@@ -25,10 +42,11 @@ type healthResponse struct {
 }
 
 type execRequest struct {
-    DeviceID  string   `json:"device_id"`
-    Command   []string `json:"command"`
-    AppType   string   `json:"app_type,omitempty"`
-    AppURL    string   `json:"app_url,omitempty"`
+    DeviceID   string      `json:"device_id"`
+    Command    []string    `json:"command"`
+    AppType    string      `json:"app_type,omitempty"`
+    AppURL     string      `json:"app_url,omitempty"`
+    Deployment *Deployment `json:"deployment,omitempty"`
 }
 
 type execResponse struct {
@@ -48,17 +66,32 @@ type deployStatusResponse struct {
 }
 
 type execRecord struct {
-    Status string
-    Output string
-    Error  string
+    DeviceID string
+    Status   string
+    Output   string
+    Error    string
+}
+
+// terminalStatuses are execRecord.Status values that end an execution's
+// lifecycle, triggering the exec_total counter and exec_duration_seconds
+// observation.
+var terminalStatuses = map[string]bool{
+    "success": true,
+    "error":   true,
+    stageHealthy: true,
+    stageFailed:  true,
+    "closed":  true,
 }
 
 var (
     tsServer *tsnet.Server
-    execStore = struct {
+    sshPool  *sshclient.Pool
+    store    *execstore.Store
+
+    execStarted = struct {
         sync.Mutex
-        data map[string]execRecord
-    }{data: make(map[string]execRecord)}
+        data map[string]time.Time
+    }{data: make(map[string]time.Time)}
 )
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,36 +122,70 @@ func execHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Support deployment (app_type + app_url) or direct command
-    var command []string
-    if req.AppType != "" && req.AppURL != "" {
-        command = buildDeployCommand(req.AppType, req.AppURL)
-    } else if len(req.Command) > 0 {
-        command = req.Command
-    } else {
-        http.Error(w, "either (app_type + app_url) or command array is required", http.StatusBadRequest)
-        return
-    }
+    // Support a structured deployment (new "deployment" field, or the
+    // legacy app_type+app_url shim), or a direct command.
+    switch {
+    case req.Deployment != nil || (req.AppType != "" && req.AppURL != ""):
+        // A capability grant that restricts app_types applies to every
+        // deployment path, not just the legacy app_type/app_url shim, so a
+        // caller can't bypass it by submitting a raw "deployment" spec.
+        if caps := callerCapabilities(r); len(caps) > 0 {
+            if req.AppType == "" || !appTypeAllowed(caps, req.AppType) {
+                http.Error(w, fmt.Sprintf("app_type %q not permitted by caller's capability grant", req.AppType), http.StatusForbidden)
+                return
+            }
+        }
 
-    execID := fmt.Sprintf("exec-%s-%d", req.DeviceID, time.Now().UnixNano())
+        deployment := deploymentFromShim(req.AppType, req.AppURL)
+        if req.Deployment != nil {
+            deployment = *req.Deployment
+        }
 
-    // Store as pending
-    recordExec(execID, execRecord{Status: "pending"})
+        execID := fmt.Sprintf("exec-%s-%d", req.DeviceID, time.Now().UnixNano())
+        recordExec(execID, execRecord{DeviceID: req.DeviceID, Status: "pending"})
+        go runDeployment(execID, req.DeviceID, deployment)
 
-    go func() {
-        output, err := runSSHCommand(req.DeviceID, command)
-        if err != nil {
-            recordExec(execID, execRecord{Status: "error", Error: err.Error(), Output: output})
-            return
+        writeJSON(w, http.StatusAccepted, execResponse{
+            ExecutionID: execID,
+            Status:      "accepted",
+            Message:     "Deployment dispatched",
+        })
+
+    case len(req.Command) > 0:
+        // The ["deploy", app_type, app_url] raw-command convention is just
+        // another way to trigger a deployment, so it's subject to the same
+        // app_type allowlist as the structured deployment path above.
+        if appType, _, ok := deployCommandArgs(req.Command); ok {
+            if caps := callerCapabilities(r); len(caps) > 0 {
+                if !appTypeAllowed(caps, appType) {
+                    http.Error(w, fmt.Sprintf("app_type %q not permitted by caller's capability grant", appType), http.StatusForbidden)
+                    return
+                }
+            }
         }
-        recordExec(execID, execRecord{Status: "success", Output: output})
-    }()
 
-    writeJSON(w, http.StatusAccepted, execResponse{
-        ExecutionID: execID,
-        Status:      "accepted",
-        Message:     "Command dispatched",
-    })
+        execID := fmt.Sprintf("exec-%s-%d", req.DeviceID, time.Now().UnixNano())
+        recordExec(execID, execRecord{DeviceID: req.DeviceID, Status: "pending"})
+        startExec(execID)
+
+        go func() {
+            output, err := runSSHCommand(req.DeviceID, req.Command)
+            if err != nil {
+                recordExec(execID, execRecord{DeviceID: req.DeviceID, Status: "error", Error: err.Error(), Output: output})
+                return
+            }
+            recordExec(execID, execRecord{DeviceID: req.DeviceID, Status: "success", Output: output})
+        }()
+
+        writeJSON(w, http.StatusAccepted, execResponse{
+            ExecutionID: execID,
+            Status:      "accepted",
+            Message:     "Command dispatched",
+        })
+
+    default:
+        http.Error(w, "either (app_type + app_url), a deployment spec, or a command array is required", http.StatusBadRequest)
+    }
 }
 
 func deployStatusHandler(w http.ResponseWriter, r *http.Request) {
@@ -143,7 +210,9 @@ func deployStatusHandler(w http.ResponseWriter, r *http.Request) {
     })
 }
 
-// SSH execution via direct TCP connection through Tailscale network
+// SSH execution through the native sshclient pool, dialed over the tsnet
+// userspace network. Set EDGEVISION_SSH_LEGACY_SHELLOUT=1 to fall back to
+// the system ssh/tailscale ssh binaries during migration.
 func runSSHCommand(deviceID string, command []string) (string, error) {
     if len(command) == 0 {
         return "", fmt.Errorf("no command provided")
@@ -154,39 +223,34 @@ func runSSHCommand(deviceID string, command []string) (string, error) {
         return "", fmt.Errorf("tsnet not initialized")
     }
 
-    target := deviceID
-    user := "root"
-    
-    // Build the deploy command to run on remote
-    var remoteCmd string
-    if len(command) >= 3 && command[0] == "deploy" {
-        appType := command[1]
-        appURL := command[2]
-        remoteCmd = fmt.Sprintf(
-            "docker pull %s && docker run -d --name %s-instance --restart=unless-stopped %s",
-            appURL, appType, appURL,
-        )
-    } else {
-        // Fallback
-        remoteCmd = "echo 'deployment command not recognized'"
-    }
-    
+    remoteCmd := buildDeployCommandString(command)
+
     ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
     defer cancel()
-    
-    // Try to connect to target via TCP (SSH port 22) to verify Tailscale connectivity
-    log.Printf("[sidecar] Testing connectivity to %s:22...", target)
-    conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:22", target), 20*time.Second)
-    if err != nil {
-        log.Printf("[sidecar] Direct TCP connection to %s failed: %v", target, err)
-        // Fallback to system SSH command anyway
+
+    if os.Getenv(legacyShellOutEnv) != "" {
+        target := deviceID
+        user := "root"
+        log.Printf("[sidecar] %s set, using legacy shell-out SSH to %s", legacyShellOutEnv, target)
         return fallbackSSH(ctx, target, user, remoteCmd)
     }
-    defer conn.Close()
-    
-    // TCP connection successful! Now use system SSH since network is reachable
-    log.Printf("[sidecar] TCP connection to %s successful, attempting SSH...", target)
-    return fallbackSSH(ctx, target, user, remoteCmd)
+
+    if sshPool == nil {
+        return "", fmt.Errorf("ssh client pool not initialized")
+    }
+
+    stdout, stderr, exitCode, err := sshPool.Run(ctx, deviceID, remoteCmd)
+    if err != nil {
+        var dialErr *sshclient.DialError
+        if errors.As(err, &dialErr) {
+            metrics.SSHDialFailures.WithLabelValues(deviceID).Inc()
+        }
+        return stdout, err
+    }
+    if exitCode != 0 {
+        return stdout, fmt.Errorf("remote command exited with status %d: %s", exitCode, stderr)
+    }
+    return stdout, nil
 }
 
 func fallbackSSH(ctx context.Context, target, user, cmd string) (string, error) {
@@ -232,53 +296,85 @@ func fallbackSSH(ctx context.Context, target, user, cmd string) (string, error)
     return outputStr, err
 }
 
-// Build Docker deploy command string
+// Build Docker deploy command string. appType and appURL come straight off
+// the wire, so every value spliced into the command line goes through
+// shQuote, the same as buildDeployScript's handling of a structured
+// Deployment.
 func buildDeployCommandString(command []string) string {
     if len(command) == 0 {
         return ""
     }
-    // For deploy commands, assume format: ["deploy", "zed", "dummy-zed:latest"]
-    if len(command) >= 3 && command[0] == "deploy" {
-        appType := command[1]
-        appURL := command[2]
-        // Build Docker deploy command
-        return fmt.Sprintf(
-            "docker pull %s && docker run -d --name %s-instance --restart=unless-stopped %s",
-            appURL,
-            appType,
-            appURL,
-        )
-    }
-    // Fallback: shouldn't reach here for normal deployments
-    return "echo 'command conversion failed'"
+    appType, appURL, ok := deployCommandArgs(command)
+    if !ok {
+        // Fallback: shouldn't reach here for normal deployments
+        return "echo 'command conversion failed'"
+    }
+    name := appType + "-instance"
+    return fmt.Sprintf(
+        "docker pull %s && docker run -d --name %s --restart=unless-stopped %s",
+        shQuote(appURL),
+        shQuote(name),
+        shQuote(appURL),
+    )
 }
 
-// Build Docker deploy command based on app_type and app_url
-func buildDeployCommand(appType, appURL string) []string {
-    // e.g., docker pull docker.io/namespace/app:latest && docker run -d --name app-instance docker.io/namespace/app:latest
-    return []string{
-        "/bin/sh", "-c",
-        fmt.Sprintf(
-            "docker pull %s && docker run -d --name %s-instance --restart=unless-stopped %s",
-            appURL,
-            appType,
-            appURL,
-        ),
+// deployCommandArgs extracts the (app_type, app_url) pair from a
+// ["deploy", app_type, app_url] shaped command array, the legacy
+// raw-command convention for triggering a deployment via /ssh/exec.
+func deployCommandArgs(command []string) (appType, appURL string, ok bool) {
+    if len(command) >= 3 && command[0] == "deploy" {
+        return command[1], command[2], true
     }
+    return "", "", false
 }
 
+// startExec marks execID as dispatched, so its eventual terminal status can
+// be timed for edgevision_exec_duration_seconds.
+func startExec(execID string) {
+    execStarted.Lock()
+    execStarted.data[execID] = time.Now()
+    execStarted.Unlock()
+}
 
+// recordExec persists rec's latest state and, on a terminal status, bumps
+// the exec_total counter and exec_duration_seconds histogram.
 func recordExec(id string, rec execRecord) {
-    execStore.Lock()
-    defer execStore.Unlock()
-    execStore.data[id] = rec
+    terminal := terminalStatuses[rec.Status]
+
+    if store != nil {
+        if err := store.Save(id, execstore.Record{DeviceID: rec.DeviceID, Status: rec.Status, Output: rec.Output, Error: rec.Error, Counted: terminal}); err != nil {
+            log.Printf("[sidecar] execstore save %s: %v", id, err)
+        }
+    }
+
+    if !terminal {
+        return
+    }
+
+    metrics.ExecTotal.WithLabelValues(rec.DeviceID, rec.Status).Inc()
+
+    execStarted.Lock()
+    started, ok := execStarted.data[id]
+    delete(execStarted.data, id)
+    execStarted.Unlock()
+    if ok {
+        metrics.ExecDuration.WithLabelValues(rec.DeviceID).Observe(time.Since(started).Seconds())
+    }
 }
 
 func loadExec(id string) (execRecord, bool) {
-    execStore.Lock()
-    defer execStore.Unlock()
-    rec, ok := execStore.data[id]
-    return rec, ok
+    if store == nil {
+        return execRecord{}, false
+    }
+    rec, ok, err := store.Load(id)
+    if err != nil {
+        log.Printf("[sidecar] execstore load %s: %v", id, err)
+        return execRecord{}, false
+    }
+    if !ok {
+        return execRecord{}, false
+    }
+    return execRecord{DeviceID: rec.DeviceID, Status: rec.Status, Output: rec.Output, Error: rec.Error}, true
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -299,29 +395,94 @@ func initTSNet() error {
     }
     _, err := tsServer.Up(context.Background())
     if err != nil {
+        metrics.TSNetReady.Set(0)
         return fmt.Errorf("tsnet up failed: %w", err)
     }
+    metrics.TSNetReady.Set(1)
     log.Printf("[sidecar] tsnet initialized successfully")
+
+    if os.Getenv(legacyShellOutEnv) == "" {
+        keyPath := os.Getenv("SIDECAR_SSH_KEY_PATH")
+        if keyPath == "" {
+            keyPath = "/etc/edgevision/ssh/id_ed25519"
+        }
+        pool, err := sshclient.NewPool(sshclient.Config{
+            User:           "root",
+            PrivateKeyPath: keyPath,
+            Dialer:         tsServer.Dial,
+        })
+        if err != nil {
+            log.Printf("[sidecar] ssh client pool init warning: %v (set %s=1 to use legacy shell-out instead)", err, legacyShellOutEnv)
+        } else {
+            sshPool = pool
+        }
+    }
+
     return nil
 }
 
+func initExecStore() error {
+    path := os.Getenv("EDGEVISION_EXEC_DB_PATH")
+    if path == "" {
+        path = defaultExecStorePath
+    }
+    s, err := execstore.Open(path, execStoreTTL)
+    if err != nil {
+        return err
+    }
+    store = s
+
+    records, err := s.All()
+    if err != nil {
+        log.Printf("[sidecar] execstore scan warning: %v", err)
+    }
+    seeded := 0
+    for id, rec := range records {
+        if !terminalStatuses[rec.Status] || rec.Counted {
+            continue
+        }
+        metrics.ExecTotal.WithLabelValues(rec.DeviceID, rec.Status).Inc()
+        if err := s.SetCounted(id); err != nil {
+            log.Printf("[sidecar] execstore mark-counted %s: %v", id, err)
+        }
+        seeded++
+    }
+    log.Printf("[sidecar] execstore opened at %s, seeded %d of %d prior records into metrics", path, seeded, len(records))
+
+    go s.CompactLoop(execStoreCompactInterval, nil)
+    return nil
+}
+
+// watchConnectionCacheSize periodically mirrors sshPool's cached connection
+// count into the edgevision_ssh_connection_cache_size gauge.
+func watchConnectionCacheSize() {
+    ticker := time.NewTicker(30 * time.Second)
+    defer ticker.Stop()
+    for range ticker.C {
+        if sshPool != nil {
+            metrics.SSHConnectionCacheSize.Set(float64(sshPool.Size()))
+        }
+    }
+}
+
 func main() {
+    if err := initExecStore(); err != nil {
+        log.Fatalf("[sidecar] execstore init failed: %v", err)
+    }
+
     // Initialize tsnet on startup
     if err := initTSNet(); err != nil {
         log.Printf("[sidecar] tsnet init warning: %v (will retry on exec)", err)
     }
 
+    go watchConnectionCacheSize()
+
     mux := http.NewServeMux()
     mux.HandleFunc("/health", healthHandler)
-    mux.HandleFunc("/ssh/exec", execHandler)
-    mux.HandleFunc("/deployments/status", deployStatusHandler)
-    mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-        writeJSON(w, http.StatusOK, map[string]any{
-            "status": "pending",
-            "message": "Metrics not implemented yet",
-            "timestamp": time.Now().UTC().Format(time.RFC3339),
-        })
-    })
+    mux.HandleFunc("/ssh/exec", requireAuth(execHandler))
+    mux.HandleFunc("/ssh/session", requireAuth(sshSessionHandler))
+    mux.HandleFunc("/deployments/status", requireAuth(deployStatusHandler))
+    mux.Handle("/metrics", promhttp.Handler())
 
     port := os.Getenv("SIDECAR_PORT")
     if port == "" {
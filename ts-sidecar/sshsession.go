@@ -0,0 +1,198 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "golang.org/x/crypto/ssh"
+
+    "github.com/shams3049/edgevision-nexus/ts-sidecar/internal/metrics"
+)
+
+// sshFrame is the typed message exchanged over the /ssh/session WebSocket.
+// Client -> server frames use "stdin" and "resize"; server -> client frames
+// use "stdout", "stderr", and "exit".
+type sshFrame struct {
+    Type string `json:"type"`
+    Data string `json:"data,omitempty"`
+    Code int    `json:"code,omitempty"`
+    Cols int    `json:"cols,omitempty"`
+    Rows int    `json:"rows,omitempty"`
+}
+
+// wsWriter serializes frame writes to a single WebSocket connection.
+// gorilla/websocket connections support exactly one concurrent writer, but
+// runInteractiveSession has stdout, stderr, and the final exit frame all
+// writing to the same conn, so every writeFrame call must go through here.
+type wsWriter struct {
+    mu   sync.Mutex
+    conn *websocket.Conn
+}
+
+func (w *wsWriter) writeFrame(frame sshFrame) error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.conn.WriteJSON(frame)
+}
+
+var sessionUpgrader = websocket.Upgrader{
+    ReadBufferSize:  4096,
+    WriteBufferSize: 4096,
+    // tsnet traffic is already confined to the tailnet; the capability
+    // check in the auth middleware is the real gate here.
+    CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// sshSessionHandler upgrades the request to a WebSocket and proxies a full
+// PTY session to the device over the same sshPool used by /ssh/exec,
+// following the Arvados container-gateway model: stdin frames are forwarded
+// to the SSH session's stdin, and stdout/stderr/exit are multiplexed back
+// as typed JSON frames.
+func sshSessionHandler(w http.ResponseWriter, r *http.Request) {
+    if sshPool == nil {
+        http.Error(w, "ssh client pool not initialized", http.StatusServiceUnavailable)
+        return
+    }
+
+    deviceID := r.URL.Query().Get("device_id")
+    if deviceID == "" {
+        http.Error(w, "device_id is required", http.StatusBadRequest)
+        return
+    }
+
+    conn, err := sessionUpgrader.Upgrade(w, r, nil)
+    if err != nil {
+        log.Printf("[sidecar] ssh/session upgrade failed: %v", err)
+        return
+    }
+    defer conn.Close()
+
+    sessionID := fmt.Sprintf("session-%s-%d", deviceID, time.Now().UnixNano())
+    startExec(sessionID)
+    recordExec(sessionID, execRecord{DeviceID: deviceID, Status: "streaming"})
+
+    metrics.ActiveSessions.Inc()
+    defer metrics.ActiveSessions.Dec()
+
+    if err := runInteractiveSession(r.Context(), conn, deviceID, sessionID); err != nil {
+        log.Printf("[sidecar] ssh/session %s ended with error: %v", sessionID, err)
+        recordExec(sessionID, execRecord{DeviceID: deviceID, Status: "error", Error: err.Error()})
+        return
+    }
+    recordExec(sessionID, execRecord{DeviceID: deviceID, Status: "closed"})
+}
+
+func runInteractiveSession(ctx context.Context, conn *websocket.Conn, deviceID, sessionID string) error {
+    w := &wsWriter{conn: conn}
+
+    client, err := sshPool.Dial(ctx, deviceID)
+    if err != nil {
+        return fmt.Errorf("dial %s: %w", deviceID, err)
+    }
+
+    sess, err := client.NewSession()
+    if err != nil {
+        return fmt.Errorf("new session to %s: %w", deviceID, err)
+    }
+    defer sess.Close()
+
+    if err := sess.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+        return fmt.Errorf("request pty: %w", err)
+    }
+
+    stdin, err := sess.StdinPipe()
+    if err != nil {
+        return fmt.Errorf("stdin pipe: %w", err)
+    }
+    stdout, err := sess.StdoutPipe()
+    if err != nil {
+        return fmt.Errorf("stdout pipe: %w", err)
+    }
+    stderr, err := sess.StderrPipe()
+    if err != nil {
+        return fmt.Errorf("stderr pipe: %w", err)
+    }
+
+    if err := sess.Shell(); err != nil {
+        return fmt.Errorf("start shell: %w", err)
+    }
+
+    log.Printf("[sidecar] ssh/session %s streaming to %s", sessionID, deviceID)
+
+    done := make(chan error, 3)
+    go streamToWS(w, "stdout", stdout, done)
+    go streamToWS(w, "stderr", stderr, done)
+    go readWSFrames(conn, stdin, sess, done)
+
+    // Wait for either the remote shell to exit or the WebSocket pump to stop.
+    waitErr := make(chan error, 1)
+    go func() { waitErr <- sess.Wait() }()
+
+    select {
+    case err := <-waitErr:
+        code := 0
+        if exitErr, ok := err.(*ssh.ExitError); ok {
+            code = exitErr.ExitStatus()
+            err = nil
+        }
+        w.writeFrame(sshFrame{Type: "exit", Code: code})
+        return err
+    case err := <-done:
+        return err
+    }
+}
+
+func streamToWS(w *wsWriter, frameType string, r interface {
+    Read([]byte) (int, error)
+}, done chan<- error) {
+    buf := make([]byte, 4096)
+    for {
+        n, err := r.Read(buf)
+        if n > 0 {
+            if werr := w.writeFrame(sshFrame{Type: frameType, Data: string(buf[:n])}); werr != nil {
+                done <- werr
+                return
+            }
+        }
+        if err != nil {
+            // End of output does not end the session: sess.Wait does, so
+            // the exit frame is still sent.
+            return
+        }
+    }
+}
+
+func readWSFrames(conn *websocket.Conn, stdin interface {
+    Write([]byte) (int, error)
+}, sess *ssh.Session, done chan<- error) {
+    for {
+        _, raw, err := conn.ReadMessage()
+        if err != nil {
+            done <- nil
+            return
+        }
+
+        var frame sshFrame
+        if err := json.Unmarshal(raw, &frame); err != nil {
+            continue
+        }
+
+        switch frame.Type {
+        case "stdin":
+            if _, err := stdin.Write([]byte(frame.Data)); err != nil {
+                done <- err
+                return
+            }
+        case "resize":
+            if err := sess.WindowChange(frame.Rows, frame.Cols); err != nil {
+                log.Printf("[sidecar] window-change failed: %v", err)
+            }
+        }
+    }
+}